@@ -0,0 +1,356 @@
+package owl
+
+import (
+	"bytes"
+	"container/list"
+	"context"
+	"crypto/sha256"
+	"encoding/gob"
+	"encoding/hex"
+	"fmt"
+	"reflect"
+	"sync"
+)
+
+// defaultTreeCacheSize bounds the number of built resolver trees kept in
+// memory. Unlike the old unbounded sync.Map, entries beyond this are
+// evicted least-recently-used.
+const defaultTreeCacheSize = 512
+
+// treeCache is an LRU of built resolver trees keyed by a structural digest
+// (field names, field shapes and tags, recursively) rather than by
+// reflect.Type, so two distinct types with the same shape share one entry -
+// and, via adaptResolverTree, the build work already done for the first
+// type seen under a digest, rather than each type paying its own full
+// buildResolverTree. Each entry can hold trees for several reflect.Types
+// that happen to hash to the same digest - eviction and pinning operate on
+// the digest as a whole.
+type treeCache struct {
+	mu     sync.Mutex
+	size   int
+	ll     *list.List
+	items  map[string]*list.Element
+	pinned map[string]bool
+}
+
+type cacheEntry struct {
+	digest string
+	trees  map[reflect.Type]*Resolver
+}
+
+var globalTreeCache = newTreeCache(defaultTreeCacheSize)
+
+func newTreeCache(size int) *treeCache {
+	return &treeCache{
+		size:   size,
+		ll:     list.New(),
+		items:  make(map[string]*list.Element),
+		pinned: make(map[string]bool),
+	}
+}
+
+// SetTreeCacheSize resizes the process-wide resolver tree cache. Call it
+// before the first New for a given schema if it should affect that build.
+func SetTreeCacheSize(size int) {
+	globalTreeCache.mu.Lock()
+	defer globalTreeCache.mu.Unlock()
+	globalTreeCache.size = size
+	for globalTreeCache.size > 0 && globalTreeCache.ll.Len() > globalTreeCache.size {
+		if !globalTreeCache.evictOldestLocked() {
+			break
+		}
+	}
+}
+
+func (c *treeCache) get(digest string, typ reflect.Type) (*Resolver, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	el, ok := c.items[digest]
+	if !ok {
+		return nil, false
+	}
+	entry := el.Value.(*cacheEntry)
+	tree, ok := entry.trees[typ]
+	if !ok {
+		return nil, false
+	}
+	c.ll.MoveToFront(el)
+	return tree, true
+}
+
+// getAny returns an arbitrary already-built tree cached under digest, if
+// any, for adaptResolverTree to clone from when a new reflect.Type hashes to
+// a digest some other type has already built a tree for. It doesn't touch
+// LRU order itself; the caller's subsequent put() does.
+func (c *treeCache) getAny(digest string) (*Resolver, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	el, ok := c.items[digest]
+	if !ok {
+		return nil, false
+	}
+	entry := el.Value.(*cacheEntry)
+	for _, tree := range entry.trees {
+		return tree, true
+	}
+	return nil, false
+}
+
+func (c *treeCache) put(digest string, typ reflect.Type, tree *Resolver) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if el, ok := c.items[digest]; ok {
+		entry := el.Value.(*cacheEntry)
+		entry.trees[typ] = tree
+		c.ll.MoveToFront(el)
+		return
+	}
+
+	el := c.ll.PushFront(&cacheEntry{digest: digest, trees: map[reflect.Type]*Resolver{typ: tree}})
+	c.items[digest] = el
+	for c.size > 0 && c.ll.Len() > c.size {
+		if !c.evictOldestLocked() {
+			// Every remaining entry is pinned: nothing left to evict, so
+			// stop rather than spin forever re-checking the same list.
+			break
+		}
+	}
+}
+
+// evictOldestLocked removes the least-recently-used unpinned entry, if any,
+// and reports whether it removed one.
+func (c *treeCache) evictOldestLocked() bool {
+	for el := c.ll.Back(); el != nil; el = el.Prev() {
+		entry := el.Value.(*cacheEntry)
+		if c.pinned[entry.digest] {
+			continue
+		}
+		c.ll.Remove(el)
+		delete(c.items, entry.digest)
+		return true
+	}
+	return false
+}
+
+// buildAndCacheResolverTree returns the tree with minimum settings (without
+// any options applied). It will load from cache if possible. Failing that,
+// if some other reflect.Type already has a tree cached under typ's digest,
+// it adapts that tree to typ instead of rebuilding from scratch - reusing
+// its already-parsed directives/skip/include rather than re-parsing tags.
+// Only a genuinely new shape pays for a full buildResolverTree.
+func buildAndCacheResolverTree(typ reflect.Type) (tree *Resolver, err error) {
+	digest := structuralDigest(typ)
+	if cached, ok := globalTreeCache.get(digest, typ); ok {
+		return cached, nil
+	}
+
+	if proto, ok := globalTreeCache.getAny(digest); ok {
+		tree = adaptResolverTree(proto, typ)
+		globalTreeCache.put(digest, typ, tree)
+		return tree, nil
+	}
+
+	tree, err = buildResolverTree(typ)
+	if err != nil {
+		return nil, err
+	}
+
+	globalTreeCache.put(digest, typ, tree)
+	return tree, nil
+}
+
+// adaptResolverTree rebuilds a resolver tree for typ by walking proto - an
+// already-built tree for a different reflect.Type that hashes to the same
+// structural digest - in lockstep, field for field. Because the digest
+// match guarantees every field's name, tag and shape line up positionally,
+// this reuses proto's already-parsed Directives/skip/include/sequential
+// instead of re-parsing tags, only swapping in typ's own concrete
+// reflect.Type/StructField at each node. This is what lets two distinct
+// types that hash to the same digest actually share build work, not just a
+// cache slot.
+func adaptResolverTree(proto *Resolver, typ reflect.Type) *Resolver {
+	return adaptResolver(proto, typ, reflect.StructField{}, nil, make(map[reflect.Type]*Resolver))
+}
+
+func adaptResolver(proto *Resolver, t reflect.Type, field reflect.StructField, parent *Resolver, canonical map[reflect.Type]*Resolver) *Resolver {
+	root := &Resolver{
+		Type:    t,
+		Field:   field,
+		Index:   -1,
+		Parent:  parent,
+		Context: context.Background(),
+	}
+
+	if !root.IsRoot() {
+		root.Directives = proto.Directives
+		root.skip = proto.skip
+		root.include = proto.include
+		root.sequential = proto.sequential
+		root.Path = append(root.Parent.Path, field.Name)
+	}
+
+	underlying := t
+	if underlying.Kind() == reflect.Ptr {
+		underlying = underlying.Elem()
+	}
+
+	if underlying.Kind() == reflect.Struct {
+		if canon, ok := canonical[underlying]; ok {
+			root.Ref = canon
+			return root
+		}
+		canonical[underlying] = root
+
+		source := proto
+		if source.Ref != nil {
+			source = source.Ref
+		}
+
+		idx := 0
+		for i := 0; i < underlying.NumField() && idx < len(source.Children); i++ {
+			newField := underlying.Field(i)
+			if !newField.IsExported() {
+				continue
+			}
+
+			protoChild := source.Children[idx]
+			idx++
+
+			child := adaptResolver(protoChild, newField.Type, newField, root, canonical)
+			child.Index = i
+			root.Children = append(root.Children, child)
+		}
+	}
+
+	return root
+}
+
+// structuralDigest computes a stable digest over a struct type: for each
+// exported field, its name, its structural shape (kind, recursively for
+// structs and pointers) and its owl tag, combined with the digests of any
+// nested struct fields. It deliberately omits the type's own name, so two
+// distinct named types with the same field shape - e.g. two types generated
+// from the same codegen template - hash identically and can share a tree.
+func structuralDigest(t reflect.Type) string {
+	h := sha256.New()
+	writeTypeDigest(h, t, map[reflect.Type]bool{})
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+// writeTypeDigest writes t's structural shape into h, without writing t's
+// own type name anywhere. seen holds the struct types currently being
+// walked on this path; a type revisited while still on the path (a
+// recursive/self-referential type, see ref.go) is written as a
+// back-reference marker instead of recursed into again. Container kinds
+// (ptr, slice, array, map, chan) fold in their element (and, for map, key)
+// type the same way, plus array length, so e.g. []string and []int - or
+// [2]int and [3]int - never collide into the same digest.
+func writeTypeDigest(h hashWriter, t reflect.Type, seen map[reflect.Type]bool) {
+	switch t.Kind() {
+	case reflect.Ptr:
+		fmt.Fprint(h, "ptr:")
+		writeTypeDigest(h, t.Elem(), seen)
+		return
+	case reflect.Slice:
+		fmt.Fprint(h, "slice:")
+		writeTypeDigest(h, t.Elem(), seen)
+		return
+	case reflect.Array:
+		fmt.Fprintf(h, "array:%d:", t.Len())
+		writeTypeDigest(h, t.Elem(), seen)
+		return
+	case reflect.Map:
+		fmt.Fprint(h, "map[")
+		writeTypeDigest(h, t.Key(), seen)
+		fmt.Fprint(h, "]")
+		writeTypeDigest(h, t.Elem(), seen)
+		return
+	case reflect.Chan:
+		fmt.Fprintf(h, "chan:%d:", t.ChanDir())
+		writeTypeDigest(h, t.Elem(), seen)
+		return
+	}
+
+	if t.Kind() != reflect.Struct {
+		fmt.Fprintf(h, "kind:%s\n", t.Kind())
+		return
+	}
+
+	if seen[t] {
+		fmt.Fprint(h, "recurse\n")
+		return
+	}
+	seen[t] = true
+	defer delete(seen, t)
+
+	fmt.Fprint(h, "struct{\n")
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		if !field.IsExported() {
+			continue
+		}
+		fmt.Fprintf(h, "field:%s tag:%s ", field.Name, field.Tag.Get(Tag()))
+		writeTypeDigest(h, field.Type, seen)
+	}
+	fmt.Fprint(h, "}\n")
+}
+
+// hashWriter is the subset of hash.Hash used here, so tests can swap in a
+// plain bytes.Buffer without pulling in crypto/sha256.
+type hashWriter interface {
+	Write(p []byte) (int, error)
+}
+
+// cachedDigest is the portable part of a cache entry: everything except the
+// *Resolver and reflect.Type, neither of which can survive a process
+// boundary. Importing a set of these doesn't skip a rebuild (the concrete
+// reflect.Type has to exist in the importing process either way), but it
+// pins the listed digests so a fresh process's cache isn't immediately
+// cold-evicting the shapes that mattered in the process that exported it.
+type cachedDigest struct {
+	Digest    string
+	TypeNames []string
+}
+
+// ExportTreeCache returns a portable snapshot of which structural digests
+// are currently cached, most-recently-used first. Pair with
+// ImportTreeCache at startup to carry pin information across restarts.
+func ExportTreeCache() ([]byte, error) {
+	globalTreeCache.mu.Lock()
+	digests := make([]cachedDigest, 0, globalTreeCache.ll.Len())
+	for el := globalTreeCache.ll.Front(); el != nil; el = el.Next() {
+		entry := el.Value.(*cacheEntry)
+		names := make([]string, 0, len(entry.trees))
+		for typ := range entry.trees {
+			names = append(names, typ.String())
+		}
+		digests = append(digests, cachedDigest{Digest: entry.digest, TypeNames: names})
+	}
+	globalTreeCache.mu.Unlock()
+
+	var buf bytes.Buffer
+	if err := gob.NewEncoder(&buf).Encode(digests); err != nil {
+		return nil, fmt.Errorf("encode tree cache: %w", err)
+	}
+	return buf.Bytes(), nil
+}
+
+// ImportTreeCache pins the digests from a snapshot produced by
+// ExportTreeCache so they survive eviction once this process builds the
+// matching trees itself.
+func ImportTreeCache(data []byte) error {
+	var digests []cachedDigest
+	if err := gob.NewDecoder(bytes.NewReader(data)).Decode(&digests); err != nil {
+		return fmt.Errorf("decode tree cache: %w", err)
+	}
+
+	globalTreeCache.mu.Lock()
+	defer globalTreeCache.mu.Unlock()
+	for _, d := range digests {
+		globalTreeCache.pinned[d.Digest] = true
+	}
+	return nil
+}
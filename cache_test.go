@@ -0,0 +1,123 @@
+package owl
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+type cacheShapeA struct {
+	X int `owl:"required"`
+}
+
+type cacheShapeB struct {
+	X int `owl:"required"`
+}
+
+// TestStructuralDigestSharesAcrossDistinctTypes verifies that two distinct
+// but structurally identical types hash to the same digest, and that both
+// of their trees can be cached under it.
+func TestStructuralDigestSharesAcrossDistinctTypes(t *testing.T) {
+	typA := reflect.TypeOf(cacheShapeA{})
+	typB := reflect.TypeOf(cacheShapeB{})
+
+	digestA := structuralDigest(typA)
+	digestB := structuralDigest(typB)
+	if digestA != digestB {
+		t.Fatalf("expected equal digests for structurally identical types, got %s vs %s", digestA, digestB)
+	}
+
+	c := newTreeCache(defaultTreeCacheSize)
+	c.put(digestA, typA, &Resolver{Type: typA})
+	c.put(digestB, typB, &Resolver{Type: typB})
+
+	if _, ok := c.get(digestA, typA); !ok {
+		t.Fatalf("expected ShapeA's tree to still be cached")
+	}
+	if _, ok := c.get(digestB, typB); !ok {
+		t.Fatalf("expected ShapeB's tree to also be cached under the shared digest")
+	}
+}
+
+// TestStructuralDigestDistinguishesElementTypes verifies that container
+// kinds fold their element (and key) type into the digest, so distinct
+// shapes behind the same bare kind don't collide into one cache bucket.
+func TestStructuralDigestDistinguishesElementTypes(t *testing.T) {
+	cases := []struct {
+		name string
+		a, b reflect.Type
+	}{
+		{"slice elem", reflect.TypeOf([]string{}), reflect.TypeOf([]int{})},
+		{"array length", reflect.TypeOf([2]int{}), reflect.TypeOf([3]int{})},
+		{"map elem", reflect.TypeOf(map[string]string{}), reflect.TypeOf(map[string]int{})},
+		{"map key", reflect.TypeOf(map[string]int{}), reflect.TypeOf(map[int]int{})},
+		{"chan elem", reflect.TypeOf(make(chan string)), reflect.TypeOf(make(chan int))},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			var bufA, bufB strings.Builder
+			writeTypeDigest(&bufA, c.a, map[reflect.Type]bool{})
+			writeTypeDigest(&bufB, c.b, map[reflect.Type]bool{})
+			if bufA.String() == bufB.String() {
+				t.Fatalf("expected %s and %s to produce distinct digests, both were %q", c.a, c.b, bufA.String())
+			}
+		})
+	}
+}
+
+// TestBuildAndCacheResolverTreeAdaptsAcrossTypes verifies that the tree
+// built for a second, structurally identical type is adapted from the first
+// type's cached tree (reusing its directives) rather than built fresh - the
+// same *Directive pointer should show up on both trees' analogous field.
+func TestBuildAndCacheResolverTreeAdaptsAcrossTypes(t *testing.T) {
+	treeA, err := buildAndCacheResolverTree(reflect.TypeOf(cacheShapeA{}))
+	if err != nil {
+		t.Fatalf("build ShapeA: %v", err)
+	}
+	treeB, err := buildAndCacheResolverTree(reflect.TypeOf(cacheShapeB{}))
+	if err != nil {
+		t.Fatalf("build ShapeB: %v", err)
+	}
+
+	if treeB.Type != reflect.TypeOf(cacheShapeB{}) {
+		t.Fatalf("expected adapted tree's Type to be ShapeB, got %v", treeB.Type)
+	}
+	if len(treeA.Children) != 1 || len(treeB.Children) != 1 {
+		t.Fatalf("expected both trees to have one child field")
+	}
+	if len(treeA.Children[0].Directives) != 1 || len(treeB.Children[0].Directives) != 1 {
+		t.Fatalf("expected both fields to carry their required directive")
+	}
+	if treeA.Children[0].Directives[0] != treeB.Children[0].Directives[0] {
+		t.Fatalf("expected ShapeB's tree to reuse ShapeA's already-parsed *Directive, not re-parse its own")
+	}
+}
+
+// TestTreeCachePutDoesNotHangWhenPinnedOverCapacity verifies that put()
+// returns even when every entry occupying a cache at capacity is pinned
+// (e.g. via ImportTreeCache), instead of spinning forever trying to evict.
+func TestTreeCachePutDoesNotHangWhenPinnedOverCapacity(t *testing.T) {
+	c := newTreeCache(1)
+	typ1 := reflect.TypeOf(struct{ A int }{})
+	typ2 := reflect.TypeOf(struct{ B int }{})
+	digest1 := structuralDigest(typ1)
+	digest2 := structuralDigest(typ2)
+
+	c.pinned[digest1] = true
+	c.pinned[digest2] = true
+	c.put(digest1, typ1, &Resolver{})
+
+	done := make(chan struct{})
+	go func() {
+		c.put(digest2, typ2, &Resolver{})
+		close(done)
+	}()
+
+	select {
+	case <-done:
+	case <-time.After(2 * time.Second):
+		t.Fatalf("put() did not return: cache is stuck in an eviction loop")
+	}
+}
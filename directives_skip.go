@@ -0,0 +1,184 @@
+package owl
+
+import (
+	"context"
+	"fmt"
+	"reflect"
+	"strings"
+	"sync"
+)
+
+const (
+	ckResolveValues contextKey = iota + 100
+	ckSkipReport
+)
+
+// WithValues makes the given values available to skip/include expressions
+// (and to any other directive that cares to read them) via $name lookups.
+// Calling it more than once merges into the existing set rather than
+// replacing it.
+func WithValues(values map[string]interface{}) ResolveOption {
+	return resolveOptionFunc(func(ctx context.Context) context.Context {
+		merged := map[string]interface{}{}
+		if existing, ok := ctx.Value(ckResolveValues).(map[string]interface{}); ok {
+			for k, v := range existing {
+				merged[k] = v
+			}
+		}
+		for k, v := range values {
+			merged[k] = v
+		}
+		return context.WithValue(ctx, ckResolveValues, merged)
+	})
+}
+
+// WithSkipReport makes Resolve append the path of every field skipped by a
+// skip/include directive to report, so callers can tell a zero value that
+// was skipped apart from one that simply resolved to zero.
+func WithSkipReport(report *[]string) ResolveOption {
+	return resolveOptionFunc(func(ctx context.Context) context.Context {
+		return context.WithValue(ctx, ckSkipReport, report)
+	})
+}
+
+// skipReportMu guards appends to a WithSkipReport slice, which sibling
+// fields resolved concurrently (see WithConcurrency) may report into at once.
+var skipReportMu sync.Mutex
+
+func reportSkipped(ctx context.Context, r *Resolver) {
+	if report, ok := ctx.Value(ckSkipReport).(*[]string); ok && report != nil {
+		skipReportMu.Lock()
+		*report = append(*report, r.PathString())
+		skipReportMu.Unlock()
+	}
+}
+
+// conditionExpr is a compiled skip=/include= expression, e.g.
+// "$role!=admin" or "$feature.beta".
+type conditionExpr struct {
+	path string // dotted path into the resolve-time values, without the '$'
+	op   string // "", "==" or "!="
+	want string // rhs literal, empty when op is ""
+}
+
+func parseConditionExpr(raw string) (*conditionExpr, error) {
+	raw = strings.TrimSpace(raw)
+	if !strings.HasPrefix(raw, "$") {
+		return nil, fmt.Errorf("owl: skip/include expression %q must start with $", raw)
+	}
+	raw = raw[1:]
+
+	for _, op := range []string{"!=", "=="} {
+		if idx := strings.Index(raw, op); idx >= 0 {
+			return &conditionExpr{
+				path: strings.TrimSpace(raw[:idx]),
+				op:   op,
+				want: strings.TrimSpace(raw[idx+len(op):]),
+			}, nil
+		}
+	}
+	return &conditionExpr{path: raw}, nil
+}
+
+func (c *conditionExpr) eval(ctx context.Context) (bool, error) {
+	values, _ := ctx.Value(ckResolveValues).(map[string]interface{})
+	val, found := lookupValue(values, strings.Split(c.path, "."))
+
+	switch c.op {
+	case "":
+		return found && truthy(val), nil
+	case "==":
+		return found && fmt.Sprint(val) == c.want, nil
+	case "!=":
+		return !found || fmt.Sprint(val) != c.want, nil
+	default:
+		return false, fmt.Errorf("owl: unsupported operator %q", c.op)
+	}
+}
+
+func lookupValue(values map[string]interface{}, path []string) (interface{}, bool) {
+	if len(path) == 0 || values == nil {
+		return nil, false
+	}
+
+	v, ok := values[path[0]]
+	if !ok {
+		return nil, false
+	}
+	if len(path) == 1 {
+		return v, true
+	}
+
+	switch next := v.(type) {
+	case map[string]interface{}:
+		return lookupValue(next, path[1:])
+	default:
+		return nil, false
+	}
+}
+
+func truthy(v interface{}) bool {
+	if v == nil {
+		return false
+	}
+	rv := reflect.ValueOf(v)
+	switch rv.Kind() {
+	case reflect.Bool:
+		return rv.Bool()
+	case reflect.String:
+		return rv.String() != ""
+	default:
+		return !rv.IsZero()
+	}
+}
+
+// extractConditionalTags pulls any "skip=" / "include=" entries out of a
+// raw owl tag, compiling them, and returns the remaining tag content so the
+// regular directive pipeline never sees (and never tries to execute) them.
+func extractConditionalTags(tag string) (rest string, skip, include *conditionExpr, err error) {
+	var kept []string
+
+	for _, part := range strings.Split(tag, ";") {
+		trimmed := strings.TrimSpace(part)
+		switch {
+		case strings.HasPrefix(trimmed, "skip="):
+			if skip, err = parseConditionExpr(strings.TrimPrefix(trimmed, "skip=")); err != nil {
+				return "", nil, nil, err
+			}
+		case strings.HasPrefix(trimmed, "include="):
+			if include, err = parseConditionExpr(strings.TrimPrefix(trimmed, "include=")); err != nil {
+				return "", nil, nil, err
+			}
+		default:
+			kept = append(kept, part)
+		}
+	}
+
+	return strings.Join(kept, ";"), skip, include, nil
+}
+
+// shouldSkip reports whether r's skip/include directives mean this field
+// (and its subtree) should be left at its zero value for this resolve.
+func (r *Resolver) shouldSkip(ctx context.Context) (bool, error) {
+	if r.skip != nil {
+		skip, err := r.skip.eval(ctx)
+		if err != nil {
+			return false, err
+		}
+		if skip {
+			return true, nil
+		}
+	}
+
+	if r.include != nil {
+		include, err := r.include.eval(ctx)
+		if err != nil {
+			return false, err
+		}
+		if !include {
+			return true, nil
+		}
+	}
+
+	return false, nil
+}
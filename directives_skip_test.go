@@ -0,0 +1,121 @@
+package owl
+
+import "testing"
+
+type skipTrueParent struct {
+	A int `owl:"skip=$hide;mark"`
+}
+
+// TestSkipTrueLeavesFieldAtZeroValue verifies that a skip= directive whose
+// condition evaluates true leaves the field at its zero value and never
+// runs its other directives.
+func TestSkipTrueLeavesFieldAtZeroValue(t *testing.T) {
+	ns := NewNamespace()
+	var ran bool
+	ns.Register("mark", execFunc(func(rt *DirectiveRuntime) error {
+		ran = true
+		rt.Value.Elem().SetInt(99)
+		return nil
+	}))
+
+	tree, err := New(skipTrueParent{}, WithNamespace(ns))
+	if err != nil {
+		t.Fatalf("New failed: %v", err)
+	}
+
+	v, err := tree.Resolve(WithValues(map[string]interface{}{"hide": true}))
+	if err != nil {
+		t.Fatalf("Resolve failed: %v", err)
+	}
+	if ran {
+		t.Fatalf("expected mark to not run once A was skipped")
+	}
+	if got := v.Elem().Field(0).Int(); got != 0 {
+		t.Fatalf("expected A to stay at its zero value, got %d", got)
+	}
+}
+
+type includeFalseParent struct {
+	A int `owl:"include=$show;mark"`
+}
+
+// TestIncludeFalseLeavesFieldAtZeroValue verifies that an include= directive
+// whose condition evaluates false has the same skip effect as skip=true.
+func TestIncludeFalseLeavesFieldAtZeroValue(t *testing.T) {
+	ns := NewNamespace()
+	var ran bool
+	ns.Register("mark", execFunc(func(rt *DirectiveRuntime) error {
+		ran = true
+		return nil
+	}))
+
+	tree, err := New(includeFalseParent{}, WithNamespace(ns))
+	if err != nil {
+		t.Fatalf("New failed: %v", err)
+	}
+
+	if _, err := tree.Resolve(WithValues(map[string]interface{}{"show": false})); err != nil {
+		t.Fatalf("Resolve failed: %v", err)
+	}
+	if ran {
+		t.Fatalf("expected mark to not run once A was excluded")
+	}
+}
+
+type skipMissingValueParent struct {
+	A int `owl:"skip=$missing;mark"`
+}
+
+// TestSkipConditionMissingValueDefaultsToNotSkipped verifies that a skip=
+// condition referring to a value that was never supplied via WithValues
+// evaluates falsy - i.e. defaults to not skipping - rather than erroring or
+// skipping by default.
+func TestSkipConditionMissingValueDefaultsToNotSkipped(t *testing.T) {
+	ns := NewNamespace()
+	var ran bool
+	ns.Register("mark", execFunc(func(rt *DirectiveRuntime) error {
+		ran = true
+		return nil
+	}))
+
+	tree, err := New(skipMissingValueParent{}, WithNamespace(ns))
+	if err != nil {
+		t.Fatalf("New failed: %v", err)
+	}
+
+	if _, err := tree.Resolve(); err != nil {
+		t.Fatalf("Resolve failed: %v", err)
+	}
+	if !ran {
+		t.Fatalf("expected mark to run: a missing skip= value should default to not skipped")
+	}
+}
+
+type skipReportParent struct {
+	A int `owl:"skip=$hide"`
+	B int
+}
+
+// TestWithSkipReportRecordsSkippedPaths verifies that WithSkipReport
+// collects the path of every field a skip/include directive actually
+// skipped, and nothing else.
+func TestWithSkipReportRecordsSkippedPaths(t *testing.T) {
+	ns := NewNamespace()
+	tree, err := New(skipReportParent{}, WithNamespace(ns))
+	if err != nil {
+		t.Fatalf("New failed: %v", err)
+	}
+
+	var report []string
+	_, err = tree.Resolve(
+		WithValues(map[string]interface{}{"hide": true}),
+		WithSkipReport(&report),
+	)
+	if err != nil {
+		t.Fatalf("Resolve failed: %v", err)
+	}
+
+	if len(report) != 1 || report[0] != "A" {
+		t.Fatalf("expected report to contain only %q, got %v", "A", report)
+	}
+}
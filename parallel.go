@@ -0,0 +1,177 @@
+package owl
+
+import (
+	"context"
+	"reflect"
+	"strings"
+	"sync"
+)
+
+// resolveConfig carries settings stashed into the context passed down
+// through resolve. It is only ever read via ckResolveConfig; the zero
+// value (concurrency 0, i.e. serial) is the previous behaviour.
+type resolveConfig struct {
+	concurrency int
+}
+
+type contextKey int
+
+const ckResolveConfig contextKey = iota
+
+// resolveOptionFunc adapts a plain function to ResolveOption.
+type resolveOptionFunc func(context.Context) context.Context
+
+func (f resolveOptionFunc) Apply(ctx context.Context) context.Context {
+	return f(ctx)
+}
+
+// WithConcurrency makes Resolve walk sibling children concurrently, up to n
+// at a time, instead of strictly depth-first. A "sequential" tag entry on a
+// field (e.g. `owl:"sequential"`) opts that field (and the wait for it) out
+// of the fan-out, so directives that depend on running in field order still
+// do. "sequential" is stripped out of the tag during build, same as skip=/
+// include=, so it is never looked up as a directive name.
+//
+// n <= 1 behaves like the default serial Resolve.
+func WithConcurrency(n int) ResolveOption {
+	return resolveOptionFunc(func(ctx context.Context) context.Context {
+		return context.WithValue(ctx, ckResolveConfig, resolveConfig{concurrency: n})
+	})
+}
+
+// extractSequentialTag pulls a "sequential" entry out of a raw owl tag
+// (already stripped of skip=/include= by extractConditionalTags), returning
+// the remaining tag content so the regular directive pipeline never sees it
+// and tries to look up an executor named "sequential" for it.
+func extractSequentialTag(tag string) (rest string, sequential bool) {
+	var kept []string
+
+	for _, part := range strings.Split(tag, ";") {
+		trimmed := strings.TrimSpace(part)
+		if trimmed == "sequential" {
+			sequential = true
+			continue
+		}
+		kept = append(kept, part)
+	}
+
+	return strings.Join(kept, ";"), sequential
+}
+
+func resolveConfigFromContext(ctx context.Context) resolveConfig {
+	cfg, _ := ctx.Value(ckResolveConfig).(resolveConfig)
+	return cfg
+}
+
+// semaphore is a minimal counting semaphore, in the spirit of
+// golang.org/x/sync/semaphore but without the extra dependency. Every
+// acquire takes exactly one slot; there are no per-acquire weights.
+type semaphore struct {
+	slots chan struct{}
+}
+
+func newSemaphore(n int) *semaphore {
+	return &semaphore{slots: make(chan struct{}, n)}
+}
+
+func (s *semaphore) acquire(ctx context.Context) error {
+	select {
+	case s.slots <- struct{}{}:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+func (s *semaphore) release() {
+	<-s.slots
+}
+
+// resolveChildren resolves root's children, either serially (the historical
+// behaviour) or concurrently when the context carries a concurrency limit
+// set via WithConcurrency.
+func (root *Resolver) resolveChildren(ctx context.Context, underlyingValue reflect.Value) error {
+	cfg := resolveConfigFromContext(ctx)
+	if cfg.concurrency <= 1 {
+		for _, child := range root.effectiveChildren() {
+			fieldValue, err := child.resolve(ctx)
+			if err != nil {
+				return &ResolveError{Err: err, Resolver: child}
+			}
+			underlyingValue.Elem().Field(child.Index).Set(fieldValue.Elem())
+		}
+		return nil
+	}
+
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	sem := newSemaphore(cfg.concurrency)
+	var wg sync.WaitGroup
+	var mu sync.Mutex
+	var firstErr error
+	firstIndex := -1
+
+	// fail records err as the reported error if child is earlier (by field
+	// index, i.e. by path) than whichever error is currently recorded, so
+	// the error Resolve ultimately returns is deterministic - the first
+	// failing field in declaration order - rather than whichever goroutine
+	// happened to fail first. It always cancels ctx so the rest of the
+	// fan-out stops promptly regardless of which error wins.
+	fail := func(child *Resolver, err error) {
+		mu.Lock()
+		if firstIndex == -1 || child.Index < firstIndex {
+			firstErr = err
+			firstIndex = child.Index
+		}
+		mu.Unlock()
+		cancel()
+	}
+
+	for _, child := range root.effectiveChildren() {
+		if child.sequential {
+			// Drain in-flight siblings first so the sequential field runs
+			// in its declared position, then resolve it inline.
+			wg.Wait()
+			mu.Lock()
+			err := firstErr
+			mu.Unlock()
+			if err != nil {
+				return err
+			}
+			fieldValue, resolveErr := child.resolve(ctx)
+			if resolveErr != nil {
+				fail(child, &ResolveError{Err: resolveErr, Resolver: child})
+				mu.Lock()
+				err := firstErr
+				mu.Unlock()
+				return err
+			}
+			underlyingValue.Elem().Field(child.Index).Set(fieldValue.Elem())
+			continue
+		}
+
+		if err := sem.acquire(ctx); err != nil {
+			fail(child, err)
+			break
+		}
+
+		wg.Add(1)
+		go func(child *Resolver) {
+			defer wg.Done()
+			defer sem.release()
+
+			fieldValue, err := child.resolve(ctx)
+			if err != nil {
+				fail(child, &ResolveError{Err: err, Resolver: child})
+				return
+			}
+			underlyingValue.Elem().Field(child.Index).Set(fieldValue.Elem())
+		}(child)
+	}
+
+	wg.Wait()
+	mu.Lock()
+	defer mu.Unlock()
+	return firstErr
+}
@@ -0,0 +1,72 @@
+package owl
+
+import (
+	"errors"
+	"testing"
+)
+
+var errFailDirective = errors.New("fail directive")
+
+type seqChild struct {
+	V int
+}
+
+type seqParent struct {
+	A int
+	B seqChild `owl:"sequential"`
+}
+
+// TestSequentialTagStripped verifies that a "sequential" tag entry does not
+// reach the regular directive pipeline - it should never need a registered
+// executor named "sequential", just opt the field out of the fan-out.
+func TestSequentialTagStripped(t *testing.T) {
+	ns := NewNamespace()
+
+	tree, err := New(seqParent{}, WithNamespace(ns))
+	if err != nil {
+		t.Fatalf("New failed: %v", err)
+	}
+
+	if _, err := tree.Resolve(WithConcurrency(4)); err != nil {
+		t.Fatalf("Resolve with WithConcurrency failed: %v", err)
+	}
+}
+
+type failingChild struct {
+	V int `owl:"fail"`
+}
+
+type multiFailParent struct {
+	A failingChild
+	B failingChild
+	C failingChild
+}
+
+// TestConcurrentResolveFirstErrorByPath verifies that when several children
+// fail concurrently, Resolve reports the error for the earliest field in
+// declaration order, not whichever goroutine happened to fail first.
+func TestConcurrentResolveFirstErrorByPath(t *testing.T) {
+	ns := NewNamespace()
+	ns.Register("fail", execFunc(func(rt *DirectiveRuntime) error {
+		return &ResolveError{Err: errFailDirective, Resolver: rt.Resolver}
+	}))
+
+	for i := 0; i < 20; i++ {
+		tree, err := New(multiFailParent{}, WithNamespace(ns))
+		if err != nil {
+			t.Fatalf("New failed: %v", err)
+		}
+
+		_, err = tree.Resolve(WithConcurrency(4))
+		if err == nil {
+			t.Fatalf("expected an error")
+		}
+		resolveErr, ok := err.(*ResolveError)
+		if !ok {
+			t.Fatalf("expected *ResolveError, got %T", err)
+		}
+		if resolveErr.Resolver.PathString() != "A" {
+			t.Fatalf("expected the first failing field (A) to be reported, got %s", resolveErr.Resolver.PathString())
+		}
+	}
+}
@@ -0,0 +1,157 @@
+package owl
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"sync"
+)
+
+// ErrMaxDepthExceeded is returned by New when a schema nests deeper than
+// the configured max build depth. See SetMaxBuildDepth.
+var ErrMaxDepthExceeded = errors.New("owl: max build depth exceeded")
+
+// defaultMaxBuildDepth bounds how deep buildResolver will recurse into
+// nested structs before giving up. Self- and mutually-referential types
+// are handled separately (they become ref nodes, see buildResolver), so
+// this mainly guards against pathological non-recursive schemas.
+const defaultMaxBuildDepth = 200
+
+var maxBuildDepth = defaultMaxBuildDepth
+var maxBuildDepthMu sync.Mutex
+
+// SetMaxBuildDepth changes the process-wide limit on how deep a resolver
+// tree may nest before New returns ErrMaxDepthExceeded. n <= 0 disables the
+// limit.
+func SetMaxBuildDepth(n int) {
+	maxBuildDepthMu.Lock()
+	defer maxBuildDepthMu.Unlock()
+	maxBuildDepth = n
+}
+
+// buildCtx carries state across one buildResolverTree call: which struct
+// types already have a canonical built node (for both cycle detection and
+// reuse of repeated types), and how deep the recursion currently is.
+type buildCtx struct {
+	canonical map[reflect.Type]*Resolver
+	depth     int
+	maxDepth  int
+}
+
+func newBuildCtx() *buildCtx {
+	maxBuildDepthMu.Lock()
+	defer maxBuildDepthMu.Unlock()
+	return &buildCtx{
+		canonical: make(map[reflect.Type]*Resolver),
+		maxDepth:  maxBuildDepth,
+	}
+}
+
+// IsRef reports whether r closes a cycle back to one of its own ancestors
+// (a recursive or mutually-referential type), rather than having been
+// walked/cloned directly. A type that simply repeats elsewhere in the tree
+// without being its own ancestor is not a ref - see the Ref field.
+func (r *Resolver) IsRef() bool {
+	return r.Ref != nil
+}
+
+// effectiveChildren returns the children to descend into: r's own for a
+// regular node, or the ancestor target's for a ref node.
+func (r *Resolver) effectiveChildren() []*Resolver {
+	if r.Ref != nil {
+		return r.Ref.Children
+	}
+	return r.Children
+}
+
+const ckRefVisited contextKey = iota + 300
+
+// refVisited reports whether r is a ref node whose canonical target has
+// already been expanded earlier on this resolve path, and returns the
+// context extended to record r's target as visited from here down. resolve
+// uses this to stop descending into a ref a second time - otherwise a
+// self-referential type (e.g. a linked list) would recurse forever, since
+// effectiveChildren on a ref node always returns the same canonical
+// Children slice. Mirrors refSeen in walk.go, which does the same thing for
+// Walk/Iterate, but threaded through context since resolve doesn't carry an
+// explicit traversal-state parameter.
+func refVisited(ctx context.Context, r *Resolver) (next context.Context, alreadyVisited bool) {
+	if r.Ref == nil {
+		return ctx, false
+	}
+
+	seen, _ := ctx.Value(ckRefVisited).(map[*Resolver]bool)
+	if seen[r.Ref] {
+		return ctx, true
+	}
+
+	extended := make(map[*Resolver]bool, len(seen)+1)
+	for k := range seen {
+		extended[k] = true
+	}
+	extended[r.Ref] = true
+	return context.WithValue(ctx, ckRefVisited, extended), false
+}
+
+// cloneNode deep-clones the physical subtree rooted at orig for one New()
+// call, following orig's Ref the same way effectiveChildren does but giving
+// each occurrence its own nodes instead of sharing the canonical target's -
+// so a field's Path reflects where it actually sits in this tree (e.g.
+// "Y.V"), not wherever its type happened to be built first (e.g. "X.V").
+//
+// active holds, for each canonical node currently being expanded on the
+// path from the root to here, the clone already created for it. A ref whose
+// target is in active is a genuine cycle (the target is an ancestor of this
+// node in the copy being built): it's left as a ref pointing at that
+// ancestor's clone, exactly as buildResolver's own cycle break does,
+// instead of being expanded again. A ref whose target is merely reused
+// elsewhere in the tree (not an ancestor here) gets a full, independently
+// pathed clone instead.
+func cloneNode(orig, newParent *Resolver, active map[*Resolver]*Resolver) *Resolver {
+	target := orig
+	if orig.Ref != nil {
+		target = orig.Ref
+	}
+
+	if existing, onPath := active[target]; onPath {
+		ref := new(Resolver)
+		*ref = *orig
+		ref.Context = context.Background()
+		ref.Children = nil
+		ref.Ref = existing
+		ref.Parent = newParent
+		return ref
+	}
+
+	clone := new(Resolver)
+	*clone = *target
+	clone.Context = context.Background()
+	clone.Ref = nil
+	clone.Parent = newParent
+	if newParent != nil {
+		// Per-occurrence fields come from orig (this field's own
+		// declaration), not target (the canonical node for the type),
+		// since two occurrences of the same type can have different
+		// tags, directives and always have a different Path.
+		clone.Field = orig.Field
+		clone.Index = orig.Index
+		clone.Directives = orig.Directives
+		clone.skip = orig.skip
+		clone.include = orig.include
+		clone.sequential = orig.sequential
+		clone.Path = append(append([]string{}, newParent.Path...), orig.Field.Name)
+	}
+
+	nextActive := make(map[*Resolver]*Resolver, len(active)+1)
+	for k, v := range active {
+		nextActive[k] = v
+	}
+	nextActive[target] = clone
+
+	clone.Children = make([]*Resolver, len(target.Children))
+	for i, child := range target.Children {
+		clone.Children[i] = cloneNode(child, clone, nextActive)
+	}
+
+	return clone
+}
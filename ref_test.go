@@ -0,0 +1,75 @@
+package owl
+
+import (
+	"testing"
+	"time"
+)
+
+type selfRefNode struct {
+	Val  int
+	Next *selfRefNode
+}
+
+// TestSelfReferentialResolveTerminates verifies that Resolve on a
+// self-referential type (the motivating example from the request) returns
+// instead of recursing forever.
+func TestSelfReferentialResolveTerminates(t *testing.T) {
+	ns := NewNamespace()
+	tree, err := New(selfRefNode{}, WithNamespace(ns))
+	if err != nil {
+		t.Fatalf("New failed: %v", err)
+	}
+
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		if _, err := tree.Resolve(); err != nil {
+			t.Errorf("Resolve failed: %v", err)
+		}
+	}()
+
+	select {
+	case <-done:
+	case <-time.After(3 * time.Second):
+		t.Fatalf("Resolve did not return: self-referential type recurses forever")
+	}
+}
+
+type refShared struct{ V int }
+
+type refParent struct {
+	X refShared
+	Y refShared
+}
+
+// TestRepeatedTypePathsAreIndependent verifies that two sibling fields of
+// the same struct type each report their own path for their descendants,
+// instead of the second occurrence reporting the first's path.
+func TestRepeatedTypePathsAreIndependent(t *testing.T) {
+	ns := NewNamespace()
+	tree, err := New(refParent{}, WithNamespace(ns))
+	if err != nil {
+		t.Fatalf("New failed: %v", err)
+	}
+
+	x := tree.Lookup("X")
+	y := tree.Lookup("Y")
+	if x == nil || y == nil {
+		t.Fatalf("expected to find both X and Y")
+	}
+	if y.IsRef() {
+		t.Fatalf("Y is a sibling reuse, not a cycle: should not be a ref node")
+	}
+
+	xv := tree.Lookup("X.V")
+	yv := tree.Lookup("Y.V")
+	if xv == nil || yv == nil {
+		t.Fatalf("expected to find both X.V and Y.V")
+	}
+	if xv.PathString() != "X.V" {
+		t.Fatalf("expected X.V's path to be %q, got %q", "X.V", xv.PathString())
+	}
+	if yv.PathString() != "Y.V" {
+		t.Fatalf("expected Y.V's path to be %q, got %q", "Y.V", yv.PathString())
+	}
+}
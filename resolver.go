@@ -6,13 +6,8 @@ import (
 	"reflect"
 	"strconv"
 	"strings"
-	"sync"
 )
 
-// Saves all the built resolver trees without applying options.
-// The key is the struct type.
-var builtTrees sync.Map
-
 // Resolver is a field resolver. Which is a node in the resolver tree.
 // The resolver tree is built from a struct value. Each node represents a
 // field in the struct. The root node represents the struct itself.
@@ -26,6 +21,21 @@ type Resolver struct {
 	Parent     *Resolver
 	Children   []*Resolver
 	Context    context.Context // save custom resolver settings here
+
+	skip    *conditionExpr // from a skip= directive, nil if none
+	include *conditionExpr // from an include= directive, nil if none
+
+	sequential bool // from a "sequential" tag entry, see WithConcurrency
+
+	// Ref points at the ancestor Resolver this node refers back to, when
+	// this node closes a cycle in a self- or mutually-referential type
+	// (e.g. Node.Next in type Node struct{ Next *Node }) instead of being
+	// walked directly. Children is empty on a ref node; use
+	// effectiveChildren to reach the ancestor's subtree. A type that merely
+	// repeats elsewhere in the tree without being its own ancestor (e.g.
+	// two sibling fields of the same struct type) is not a ref - it gets
+	// its own, independently built/cloned subtree instead. See ref.go.
+	Ref *Resolver
 }
 
 // New builds a resolver tree from a struct value. The given options will be
@@ -43,9 +53,12 @@ func New(structValue interface{}, opts ...Option) (*Resolver, error) {
 	}
 	tree = tree.copy()
 
-	// Apply options to each resolver.
+	// Apply options to each physical resolver once. Ref nodes are visited
+	// here too (they still need e.g. a namespace), but we don't descend
+	// through them into their canonical target's children - those children
+	// have their own position in the tree and get the options there.
 	opts = normalizeOptions(opts)
-	if err := tree.Iterate(func(r *Resolver) error {
+	if err := iteratePhysicalTree(tree, func(r *Resolver) error {
 		for _, opt := range opts {
 			if err := opt.Apply(r); err != nil {
 				return err
@@ -63,18 +76,13 @@ func New(structValue interface{}, opts ...Option) (*Resolver, error) {
 	return tree, nil
 }
 
+// copy deep-copies the tree rooted at r for one New() call. A ref node
+// pointing at an ancestor (a cycle) is rewired to the corresponding
+// ancestor copy; a ref node pointing at a node reused elsewhere in the tree
+// (not an ancestor) gets its own independently pathed clone of that node's
+// subtree instead of sharing it. See cloneNode in ref.go.
 func (r *Resolver) copy() *Resolver {
-	resolverCopy := new(Resolver)
-	*resolverCopy = *r
-	resolverCopy.Context = context.Background()
-
-	// Copy the children.
-	resolverCopy.Children = make([]*Resolver, len(r.Children))
-	for i, child := range r.Children {
-		resolverCopy.Children[i] = child.copy()
-		resolverCopy.Children[i].Parent = resolverCopy
-	}
-	return resolverCopy
+	return cloneNode(r, nil, make(map[*Resolver]*Resolver))
 }
 
 func (r *Resolver) validate() error {
@@ -120,7 +128,7 @@ func findResolver(root *Resolver, path []string) *Resolver {
 		return root
 	}
 
-	for _, field := range root.Children {
+	for _, field := range root.effectiveChildren() {
 		if field.Field.Name == path[0] {
 			return findResolver(field, path[1:])
 		}
@@ -130,28 +138,38 @@ func findResolver(root *Resolver, path []string) *Resolver {
 }
 
 func (r *Resolver) String() string {
+	if r.IsRef() {
+		return fmt.Sprintf("%s (%v, ref -> %s)", r.PathString(), r.Type, r.Ref.PathString())
+	}
 	return fmt.Sprintf("%s (%v)", r.PathString(), r.Type)
 }
 
 // Iterate iterates the resolver tree by depth-first. The callback function
 // will be called for each field resolver. If the callback returns an error,
-// the iteration will be stopped.
+// the iteration will be stopped. Ref nodes (see IsRef) are followed
+// transparently into their canonical subtree, with a cycle broken after one
+// expansion. Iterate is a thin shim over Walk(PreOrder, ...) that always
+// descends; use Walk directly for post-order, breadth-first, leaf-only, or
+// pruning traversals.
 func (r *Resolver) Iterate(fn func(*Resolver) error) error {
-	return iterateTree(r, fn)
+	return r.Walk(PreOrder, funcVisitor{enter: func(n *Resolver) (bool, error) {
+		return true, fn(n)
+	}})
 }
 
-func iterateTree(root *Resolver, fn func(*Resolver) error) error {
-	if err := fn(root); err != nil {
-		return err
-	}
-
-	for _, field := range root.Children {
-		if err := iterateTree(field, fn); err != nil {
-			return err
+// iteratePhysicalTree iterates only the nodes actually built for this tree,
+// i.e. it does not descend through a ref node into its canonical target's
+// children (those children have their own, separate position in the tree).
+// It's Walk(PreOrder, ...) with descend forced to false on ref nodes, since
+// PreOrder only follows effectiveChildren - which is the canonical target's
+// Children for a ref node - when the visitor asks it to.
+func iteratePhysicalTree(root *Resolver, fn func(*Resolver) error) error {
+	return root.Walk(PreOrder, funcVisitor{enter: func(r *Resolver) (bool, error) {
+		if err := fn(r); err != nil {
+			return false, err
 		}
-	}
-
-	return nil
+		return !r.IsRef(), nil
+	}})
 }
 
 // Resolve resolves the resolver tree from a data source.
@@ -166,16 +184,43 @@ func (r *Resolver) Resolve(opts ...ResolveOption) (reflect.Value, error) {
 	return r.resolve(ctx)
 }
 
+// resolve does not route through Walk, unlike Iterate, New's option
+// application and DebugLayoutText: it builds and returns a reflect.Value per
+// node instead of just running side effects, fans children out concurrently
+// (see parallel.go), and threads resolve-scoped state (skip/include,
+// ref-visited, WithValues) through context rather than a Visitor's
+// Enter/Leave hooks. None of that fits Enter(r) (bool, error)/Leave(r) error,
+// so resolve/resolveChildren keep their own recursion.
 func (root *Resolver) resolve(ctx context.Context) (reflect.Value, error) {
 	rootValue := reflect.New(root.Type)
 
+	if skip, err := root.shouldSkip(ctx); err != nil {
+		return rootValue, err
+	} else if skip {
+		// Leave the field (and its subtree) at its zero value, and run
+		// nothing else for it.
+		reportSkipped(ctx, root)
+		return rootValue, nil
+	}
+
 	// Run the directives on current field.
 	if err := root.runDirectives(ctx, rootValue); err != nil {
 		return rootValue, err
 	}
 
-	// Resolve the children fields.
-	if len(root.Children) > 0 {
+	// If root is a ref whose canonical target was already followed once
+	// through a ref further up this same path, this is a genuine cycle
+	// (e.g. a self-referential linked list) that has had its one
+	// expansion: stop here and leave it at its zero value rather than
+	// following the ref back into the same subtree forever.
+	ctx, cycle := refVisited(ctx, root)
+	if cycle {
+		return rootValue, nil
+	}
+
+	// Resolve the children fields (following a ref to its canonical subtree,
+	// if this node is one).
+	if len(root.effectiveChildren()) > 0 {
 		// If the root is a pointer, we need to allocate memory for it.
 		// We only expect it's a one-level pointer, e.g. *User, not **User.
 		underlyingValue := rootValue
@@ -184,15 +229,8 @@ func (root *Resolver) resolve(ctx context.Context) (reflect.Value, error) {
 			rootValue.Elem().Set(underlyingValue)
 		}
 
-		for _, child := range root.Children {
-			fieldValue, err := child.resolve(ctx)
-			if err != nil {
-				return rootValue, &ResolveError{
-					Err:      err,
-					Resolver: child,
-				}
-			}
-			underlyingValue.Elem().Field(child.Index).Set(fieldValue.Elem())
+		if err := root.resolveChildren(ctx, underlyingValue); err != nil {
+			return rootValue, err
 		}
 	}
 
@@ -228,45 +266,70 @@ func (r *Resolver) runDirectives(ctx context.Context, rv reflect.Value) error {
 	return nil
 }
 
+// DebugLayoutText renders the physical subtree rooted at r (not following
+// refs into their canonical target, same as iteratePhysicalTree) as an
+// indented tree: r's own line, then one "i# " line per child, indented four
+// spaces per level of nesting plus four per unit of depth. It's built on
+// top of Walk(PreOrder, ...) rather than hand-recursing over r.Children:
+// each node's rendered text is assembled bottom-up on Leave, from a stack of
+// in-progress builders, and spliced into its parent's with an "i# " prefix.
 func (r *Resolver) DebugLayoutText(depth int) string {
-	var sb strings.Builder
-	sb.WriteString(r.String())
-	sb.WriteString(fmt.Sprintf("  %v", r.Index))
-
-	for i, field := range r.Children {
-		sb.WriteString("\n")
-		sb.WriteString(strings.Repeat("    ", depth+1))
-		sb.WriteString(strconv.Itoa(i))
-		sb.WriteString("# ")
-		sb.WriteString(field.DebugLayoutText(depth + 1))
+	type frame struct {
+		sb       strings.Builder
+		childIdx int
 	}
-	return sb.String()
-}
 
-// buildAndCacheResolverTree returns the tree with minimum settings (without any
-// options applied). It will load from cache if possible. Otherwise, it will
-// build the tree from scratch and cache it.
-func buildAndCacheResolverTree(typ reflect.Type) (tree *Resolver, err error) {
-	if builtTree, ok := builtTrees.Load(typ); ok {
-		return builtTree.(*Resolver), nil
+	out := &frame{}
+	stack := []*frame{out}
+	level := -1
+
+	visitor := hookVisitor{
+		enter: func(n *Resolver) (bool, error) {
+			level++
+			f := &frame{}
+			f.sb.WriteString(n.String())
+			f.sb.WriteString(fmt.Sprintf("  %v", n.Index))
+			stack = append(stack, f)
+			return !n.IsRef(), nil
+		},
+		leave: func(n *Resolver) error {
+			f := stack[len(stack)-1]
+			stack = stack[:len(stack)-1]
+			parent := stack[len(stack)-1]
+
+			if parent == out {
+				// n is the node DebugLayoutText was called on: no "i# "
+				// prefix, its own line is the whole result.
+				out.sb.WriteString(f.sb.String())
+			} else {
+				parent.sb.WriteString("\n")
+				parent.sb.WriteString(strings.Repeat("    ", depth+level))
+				parent.sb.WriteString(strconv.Itoa(parent.childIdx))
+				parent.sb.WriteString("# ")
+				parent.sb.WriteString(f.sb.String())
+				parent.childIdx++
+			}
+			level--
+			return nil
+		},
 	}
 
-	tree, err = buildResolverTree(typ)
-	if err != nil {
-		return nil, err
+	if err := r.Walk(PreOrder, visitor); err != nil {
+		return fmt.Sprintf("<debug layout error: %v>", err)
 	}
-
-	// Build successfully, cache it (must a copy).
-	builtTrees.Store(typ, tree)
-	return tree, nil
+	return out.sb.String()
 }
 
 // buildResolverTree builds a resolver tree from a struct type.
 func buildResolverTree(st reflect.Type) (*Resolver, error) {
-	return buildResolver(st, reflect.StructField{}, nil)
+	return buildResolver(st, reflect.StructField{}, nil, newBuildCtx())
 }
 
-func buildResolver(t reflect.Type, field reflect.StructField, parent *Resolver) (*Resolver, error) {
+func buildResolver(t reflect.Type, field reflect.StructField, parent *Resolver, bc *buildCtx) (*Resolver, error) {
+	if bc.maxDepth > 0 && bc.depth > bc.maxDepth {
+		return nil, fmt.Errorf("%w: exceeded max depth %d", ErrMaxDepthExceeded, bc.maxDepth)
+	}
+
 	root := &Resolver{
 		Type:    t,
 		Field:   field,
@@ -276,7 +339,17 @@ func buildResolver(t reflect.Type, field reflect.StructField, parent *Resolver)
 	}
 
 	if !root.IsRoot() {
-		directives, err := parseDirectives(field.Tag.Get(Tag()))
+		rest, skip, include, err := extractConditionalTags(field.Tag.Get(Tag()))
+		if err != nil {
+			return nil, fmt.Errorf("parse skip/include: %w", err)
+		}
+		root.skip = skip
+		root.include = include
+
+		rest, sequential := extractSequentialTag(rest)
+		root.sequential = sequential
+
+		directives, err := parseDirectives(rest)
 		if err != nil {
 			return nil, fmt.Errorf("parse directives: %w", err)
 		}
@@ -284,13 +357,32 @@ func buildResolver(t reflect.Type, field reflect.StructField, parent *Resolver)
 		root.Path = append(root.Parent.Path, field.Name)
 	}
 
-	if t.Kind() == reflect.Ptr {
-		t = t.Elem()
+	underlying := t
+	if underlying.Kind() == reflect.Ptr {
+		underlying = underlying.Elem()
 	}
 
-	if t.Kind() == reflect.Struct {
-		for i := 0; i < t.NumField(); i++ {
-			field := t.Field(i)
+	if underlying.Kind() == reflect.Struct {
+		// A struct type we've already built (an ancestor on the current
+		// path, or a sibling reuse elsewhere in the tree) becomes a ref
+		// node instead of being walked again here. copy() later tells the
+		// two cases apart: an ancestor stays a ref (it's a genuine cycle),
+		// while a sibling reuse gets its own cloned, independently pathed
+		// subtree. See cloneNode in ref.go.
+		if canonical, ok := bc.canonical[underlying]; ok {
+			root.Ref = canonical
+			return root, nil
+		}
+
+		// Record this node as the canonical one for its type before
+		// descending, so a self-reference further down (or a sibling that
+		// reuses the same type later) becomes a ref instead of a rebuild.
+		bc.canonical[underlying] = root
+		bc.depth++
+		defer func() { bc.depth-- }()
+
+		for i := 0; i < underlying.NumField(); i++ {
+			field := underlying.Field(i)
 
 			// Skip unexported fields. Because we can't set value to them, nor
 			// get value from them by reflection.
@@ -298,7 +390,7 @@ func buildResolver(t reflect.Type, field reflect.StructField, parent *Resolver)
 				continue
 			}
 
-			child, err := buildResolver(field.Type, field, root)
+			child, err := buildResolver(field.Type, field, root, bc)
 			if err != nil {
 				path := append(root.Path, field.Name)
 				return nil, fmt.Errorf("build resolver for %q failed: %w", strings.Join(path, "."), err)
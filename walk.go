@@ -0,0 +1,201 @@
+package owl
+
+import "fmt"
+
+// WalkStrategy selects the order Walk visits nodes in.
+type WalkStrategy int
+
+const (
+	// PreOrder visits a node before its children. This is what Iterate does.
+	PreOrder WalkStrategy = iota
+	// PostOrder visits a node after its children (and all their
+	// descendants), useful for passes that bubble information (e.g.
+	// validation errors) up from leaves to root. Because a node's children
+	// are always visited before the node itself, Enter's descend return
+	// value is not used for pruning under PostOrder - there's no point in
+	// the walk at which "don't visit this node's children" can still be
+	// honoured.
+	PostOrder
+	// BreadthFirst visits all nodes at a given depth before descending to
+	// the next, useful for prioritising shallow, cheap directives first.
+	BreadthFirst
+	// LeafOnly only visits nodes with no children, skipping over structs
+	// that merely contain other fields.
+	LeafOnly
+)
+
+// Visitor is called by Walk for each node visited. For PreOrder,
+// BreadthFirst and LeafOnly, Enter runs before a node's children (if any)
+// are visited, and returning descend=false prunes the subtree (Walk won't
+// visit its children, though Leave is still called for the node itself).
+// For PostOrder, Enter instead runs after a node's children (and all their
+// descendants) have already been visited, so there is nothing left to
+// prune - its descend return value is ignored. Leave runs after a node's
+// subtree has been visited for every strategy except BreadthFirst, which
+// has no subtree-complete notion and calls it immediately after Enter
+// instead.
+type Visitor interface {
+	Enter(*Resolver) (descend bool, err error)
+	Leave(*Resolver) error
+}
+
+// funcVisitor adapts a plain pre-order callback to the Visitor interface,
+// for callers that only care about visiting every node (e.g. Iterate).
+type funcVisitor struct {
+	enter func(*Resolver) (bool, error)
+}
+
+func (f funcVisitor) Enter(r *Resolver) (bool, error) { return f.enter(r) }
+func (f funcVisitor) Leave(*Resolver) error           { return nil }
+
+// hookVisitor adapts separate enter/leave callbacks to the Visitor
+// interface, for internal callers (e.g. DebugLayoutText) that need both
+// hooks instead of just a pre-order-only callback.
+type hookVisitor struct {
+	enter func(*Resolver) (bool, error)
+	leave func(*Resolver) error
+}
+
+func (h hookVisitor) Enter(r *Resolver) (bool, error) { return h.enter(r) }
+func (h hookVisitor) Leave(r *Resolver) error         { return h.leave(r) }
+
+// Walk traverses the tree rooted at r using strategy, calling visitor's
+// hooks for each node visited. Ref nodes (see IsRef) are followed
+// transparently into their canonical subtree, same as Iterate, with a
+// cycle broken after one expansion.
+func (r *Resolver) Walk(strategy WalkStrategy, visitor Visitor) error {
+	switch strategy {
+	case PreOrder:
+		return walkPreOrder(r, visitor, nil)
+	case PostOrder:
+		return walkPostOrder(r, visitor, nil)
+	case BreadthFirst:
+		return walkBreadthFirst(r, visitor)
+	case LeafOnly:
+		return walkLeafOnly(r, visitor, nil)
+	default:
+		return fmt.Errorf("owl: unknown walk strategy %d", strategy)
+	}
+}
+
+// refSeen returns the set of canonical resolvers already expanded on the
+// current path, extended with canonical if r is a ref node not already in
+// it. ok is false if r is a ref whose target is already in seen, meaning
+// the caller should not descend further.
+func refSeen(r *Resolver, seen map[*Resolver]bool) (next map[*Resolver]bool, ok bool) {
+	if r.Ref == nil {
+		return seen, true
+	}
+	if seen[r.Ref] {
+		return seen, false
+	}
+	next = make(map[*Resolver]bool, len(seen)+1)
+	for k := range seen {
+		next[k] = true
+	}
+	next[r.Ref] = true
+	return next, true
+}
+
+func walkPreOrder(r *Resolver, visitor Visitor, seen map[*Resolver]bool) error {
+	descend, err := visitor.Enter(r)
+	if err != nil {
+		return err
+	}
+
+	if descend {
+		next, ok := refSeen(r, seen)
+		if ok {
+			for _, child := range r.effectiveChildren() {
+				if err := walkPreOrder(child, visitor, next); err != nil {
+					return err
+				}
+			}
+		}
+	}
+
+	return visitor.Leave(r)
+}
+
+func walkPostOrder(r *Resolver, visitor Visitor, seen map[*Resolver]bool) error {
+	next, ok := refSeen(r, seen)
+	if ok {
+		for _, child := range r.effectiveChildren() {
+			if err := walkPostOrder(child, visitor, next); err != nil {
+				return err
+			}
+		}
+	}
+
+	// Children (and their descendants) are already fully visited above, so
+	// there's nothing left to prune - descend is ignored.
+	if _, err := visitor.Enter(r); err != nil {
+		return err
+	}
+
+	return visitor.Leave(r)
+}
+
+// bfsQueueItem pairs a queued node with the ref-visited set on its path, so
+// BreadthFirst tracks cycles per-path like the other strategies (via
+// refSeen) instead of a single map shared across the whole walk - two
+// sibling fields of the same repeated type must each get their subtree
+// expanded, not just whichever is dequeued first.
+type bfsQueueItem struct {
+	r    *Resolver
+	seen map[*Resolver]bool
+}
+
+func walkBreadthFirst(root *Resolver, visitor Visitor) error {
+	queue := []bfsQueueItem{{r: root}}
+
+	for len(queue) > 0 {
+		item := queue[0]
+		queue = queue[1:]
+
+		descend, err := visitor.Enter(item.r)
+		if err != nil {
+			return err
+		}
+		if err := visitor.Leave(item.r); err != nil {
+			return err
+		}
+		if !descend {
+			continue
+		}
+
+		next, ok := refSeen(item.r, item.seen)
+		if !ok {
+			continue
+		}
+
+		for _, child := range item.r.effectiveChildren() {
+			queue = append(queue, bfsQueueItem{r: child, seen: next})
+		}
+	}
+
+	return nil
+}
+
+func walkLeafOnly(r *Resolver, visitor Visitor, seen map[*Resolver]bool) error {
+	children := r.effectiveChildren()
+	if len(children) == 0 {
+		if _, err := visitor.Enter(r); err != nil {
+			return err
+		}
+		return visitor.Leave(r)
+	}
+
+	next, ok := refSeen(r, seen)
+	if !ok {
+		return nil
+	}
+
+	for _, child := range children {
+		if err := walkLeafOnly(child, visitor, next); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,104 @@
+package owl
+
+import (
+	"reflect"
+	"testing"
+)
+
+type walkInner struct{ C int }
+type walkOuter struct {
+	A int
+	B walkInner
+}
+
+// TestPostOrderVisitsChildrenBeforeParent verifies that PostOrder actually
+// visits a node's descendants before the node itself, unlike PreOrder.
+func TestPostOrderVisitsChildrenBeforeParent(t *testing.T) {
+	ns := NewNamespace()
+	tree, err := New(walkOuter{}, WithNamespace(ns))
+	if err != nil {
+		t.Fatalf("New failed: %v", err)
+	}
+
+	var preSeq, postSeq []string
+	collect := func(seq *[]string) Visitor {
+		return funcVisitor{enter: func(r *Resolver) (bool, error) {
+			*seq = append(*seq, r.PathString())
+			return true, nil
+		}}
+	}
+	if err := tree.Walk(PreOrder, collect(&preSeq)); err != nil {
+		t.Fatalf("PreOrder walk failed: %v", err)
+	}
+	if err := tree.Walk(PostOrder, collect(&postSeq)); err != nil {
+		t.Fatalf("PostOrder walk failed: %v", err)
+	}
+
+	if reflect.DeepEqual(preSeq, postSeq) {
+		t.Fatalf("expected PreOrder and PostOrder visit sequences to differ, both were %v", preSeq)
+	}
+
+	bIdx, cIdx := -1, -1
+	for i, p := range postSeq {
+		switch p {
+		case "B":
+			bIdx = i
+		case "B.C":
+			cIdx = i
+		}
+	}
+	if cIdx == -1 || bIdx == -1 || cIdx > bIdx {
+		t.Fatalf("expected PostOrder to visit B.C before B, got %v", postSeq)
+	}
+}
+
+type bfsNode struct {
+	Left  *bfsNode
+	Right *bfsNode
+}
+
+// TestBreadthFirstVisitsRepeatedTypeSiblings verifies that BreadthFirst
+// expands the one-level cycle on both of two sibling ref branches reaching
+// the same ancestor type (e.g. Left and Right both pointing back at the
+// root), instead of the second sibling's ref being silently dropped because
+// the first already "expanded" that ancestor in a walk-wide map.
+func TestBreadthFirstVisitsRepeatedTypeSiblings(t *testing.T) {
+	ns := NewNamespace()
+	tree, err := New(bfsNode{}, WithNamespace(ns))
+	if err != nil {
+		t.Fatalf("New failed: %v", err)
+	}
+
+	left := tree.Lookup("Left")
+	right := tree.Lookup("Right")
+	if left == nil || right == nil {
+		t.Fatalf("expected to find both Left and Right")
+	}
+	if !left.IsRef() || !right.IsRef() {
+		t.Fatalf("expected both Left and Right to be refs back to the root (a genuine cycle)")
+	}
+
+	var preCount, bfsCount int
+	countingVisitor := func(n *int) Visitor {
+		return funcVisitor{enter: func(r *Resolver) (bool, error) {
+			*n++
+			return true, nil
+		}}
+	}
+	if err := tree.Walk(PreOrder, countingVisitor(&preCount)); err != nil {
+		t.Fatalf("PreOrder walk failed: %v", err)
+	}
+	if err := tree.Walk(BreadthFirst, countingVisitor(&bfsCount)); err != nil {
+		t.Fatalf("BreadthFirst walk failed: %v", err)
+	}
+
+	// Both Left and Right are one-level-expandable refs to the root: PreOrder
+	// visits root, Left, Left's expansion (Left.Left, Left.Right as leaf
+	// refs), Right, Right's expansion (Right.Left, Right.Right as leaf
+	// refs) - 7 nodes. The old global-map bug would make BreadthFirst skip
+	// Right's expansion entirely since Left already "used up" the root's
+	// single expansion.
+	if bfsCount != preCount {
+		t.Fatalf("expected BreadthFirst to visit the same number of nodes as PreOrder (%d), got %d", preCount, bfsCount)
+	}
+}